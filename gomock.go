@@ -5,17 +5,20 @@ import (
 	"bytes"
 	"fmt"
 	"go/ast"
-	"go/build"
 	"go/parser"
 	"go/printer"
 	"go/token"
+	"go/types"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"text/template"
+	"unicode"
 
 	"github.com/pborman/getopt"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/imports"
 )
 
@@ -26,24 +29,140 @@ Generates mocks for a go interface.
 	Package name or path to the package of interface to mock
 
 <interface>
-	Name of the interface to mock
+	Name of the interface to mock, or a comma-separated list (e.g.
+	"Reader,Writer,Closer") to batch several mocks into one file
 
 Examples:
     gomock hash Hash
-    gomock golang.org/x/tools/godoc/analysis Link 
+    gomock golang.org/x/tools/godoc/analysis Link
 
     gomock --package testutils io Reader
     gomock --directory $GOPATH/src/github.com/pedrogameiro/gomock hash Hash
+    gomock --style=recorder io Reader
+    gomock --destination ./mocks/mock_store.go mypkg Store
+    gomock --destination ./store_mocks.go --self_package mypkg mypkg Store
+    gomock --destination ./io_mocks.go io Reader,Writer,Closer
 `
 
-// findInterface returns the import path and identifier of an interface.
+// Type identifies an interface to mock, along with any type arguments
+// the user supplied for a generic interface, e.g. "Store[string, int]"
+// parses to Type{Name: "Store", Args: []string{"string", "int"}}.
+type Type struct {
+	Name string
+	Args []string
+}
+
+// String renders t the way the user would have typed it.
+func (t Type) String() string {
+	if len(t.Args) == 0 {
+		return t.Name
+	}
+	return t.Name + "[" + strings.Join(t.Args, ", ") + "]"
+}
+
+// exprString pretty-prints e using a throwaway FileSet; e carries no
+// position information worth preserving.
+func exprString(e ast.Expr) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, token.NewFileSet(), e)
+	return buf.String()
+}
+
+// splitInterfaceNames splits a batched interface list such as
+// "Reader,Writer,Closer" or "Store[string, int],Other" on top-level
+// commas only, so a generic interface's own comma-separated type
+// argument list isn't mistaken for a batch separator.
+func splitInterfaceNames(s string) []string {
+	var names []string
+	depth := 0
+	start := 0
+	for i, r := range s {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				names = append(names, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(names, s[start:])
+}
+
+// parseTypeName parses a possibly-generic bare type name such as
+// "Store[string, int]" or "ResponseWriter" into a Type.
+func parseTypeName(s string) (Type, error) {
+	expr, err := parser.ParseExpr(s)
+	if err != nil {
+		return Type{}, fmt.Errorf("couldn't parse interface: %s", s)
+	}
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return Type{Name: e.Name}, nil
+	case *ast.IndexExpr:
+		id, ok := e.X.(*ast.Ident)
+		if !ok {
+			return Type{}, fmt.Errorf("couldn't parse interface: %s", s)
+		}
+		return Type{Name: id.Name, Args: []string{exprString(e.Index)}}, nil
+	case *ast.IndexListExpr:
+		id, ok := e.X.(*ast.Ident)
+		if !ok {
+			return Type{}, fmt.Errorf("couldn't parse interface: %s", s)
+		}
+		args := make([]string, len(e.Indices))
+		for i, idx := range e.Indices {
+			args[i] = exprString(idx)
+		}
+		return Type{Name: id.Name, Args: args}, nil
+	default:
+		return Type{}, fmt.Errorf("couldn't parse interface: %s", s)
+	}
+}
+
+// splitSelector peels the type arguments, if any, off of a parsed
+// "pkg.Iface[T, U]" expression and returns the underlying selector
+// together with the argument expressions.
+func splitSelector(expr ast.Expr) (sel *ast.SelectorExpr, targs []ast.Expr, err error) {
+	switch e := expr.(type) {
+	case *ast.SelectorExpr:
+		return e, nil, nil
+	case *ast.IndexExpr:
+		sel, ok := e.X.(*ast.SelectorExpr)
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported interface expression: %s", exprString(expr))
+		}
+		return sel, []ast.Expr{e.Index}, nil
+	case *ast.IndexListExpr:
+		sel, ok := e.X.(*ast.SelectorExpr)
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported interface expression: %s", exprString(expr))
+		}
+		return sel, e.Indices, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported interface expression: %s", exprString(expr))
+	}
+}
+
+// findInterface returns the import path and Type of an interface.
 // For example, given "http.ResponseWriter", findInterface returns
-// "net/http", "ResponseWriter".
+// "net/http", Type{Name: "ResponseWriter"}.
 // If a fully qualified interface is given, such as "net/http.ResponseWriter",
-// it simply parses the input.
-func findInterface(iface string, srcDir string) (path string, id string, err error) {
-	if len(strings.Fields(iface)) != 1 {
-		return "", "", fmt.Errorf("couldn't parse interface: %s", iface)
+// it simply parses the input. Generic interfaces may carry type arguments
+// in brackets, e.g. "mypkg.Store[string, int]".
+func findInterface(iface string, srcDir string) (path string, typ Type, err error) {
+	// Type arguments may contain ", "-separated whitespace (e.g.
+	// "Store[string, int]"), so only check for stray whitespace outside
+	// of the type argument list.
+	bare := iface
+	if bracket := strings.IndexByte(iface, '['); bracket > -1 {
+		bare = iface[:bracket]
+	}
+	if len(strings.Fields(bare)) != 1 {
+		return "", Type{}, fmt.Errorf("couldn't parse interface: %s", iface)
 	}
 
 	srcPath := filepath.Join(srcDir, "__go_impl__.go")
@@ -53,17 +172,21 @@ func findInterface(iface string, srcDir string) (path string, id string, err err
 		dot := strings.LastIndex(iface, ".")
 		// make sure iface does not end with "/" (e.g. reject net/http/)
 		if slash+1 == len(iface) {
-			return "", "", fmt.Errorf("interface name cannot end with a '/' character: %s", iface)
+			return "", Type{}, fmt.Errorf("interface name cannot end with a '/' character: %s", iface)
 		}
 		// make sure iface does not end with "." (e.g. reject net/http.)
 		if dot+1 == len(iface) {
-			return "", "", fmt.Errorf("interface name cannot end with a '.' character: %s", iface)
+			return "", Type{}, fmt.Errorf("interface name cannot end with a '.' character: %s", iface)
 		}
 		// make sure iface has exactly one "." after "/" (e.g. reject net/http/httputil)
 		if strings.Count(iface[slash:], ".") != 1 {
-			return "", "", fmt.Errorf("invalid interface name: %s", iface)
+			return "", Type{}, fmt.Errorf("invalid interface name: %s", iface)
+		}
+		typ, err = parseTypeName(iface[dot+1:])
+		if err != nil {
+			return "", Type{}, err
 		}
-		return iface[:dot], iface[dot+1:], nil
+		return iface[:dot], typ, nil
 	}
 
 	src := []byte("package hack\n" + "var i " + iface)
@@ -71,7 +194,7 @@ func findInterface(iface string, srcDir string) (path string, id string, err err
 	// auto fix the import path.
 	imp, err := imports.Process(srcPath, src, nil)
 	if err != nil {
-		return "", "", fmt.Errorf("couldn't parse interface: %s", iface)
+		return "", Type{}, fmt.Errorf("couldn't parse interface: %s", iface)
 	}
 
 	// imp should now contain an appropriate import.
@@ -82,7 +205,7 @@ func findInterface(iface string, srcDir string) (path string, id string, err err
 		panic(err)
 	}
 	if len(f.Imports) == 0 {
-		return "", "", fmt.Errorf("unrecognized interface: %s", iface)
+		return "", Type{}, fmt.Errorf("unrecognized interface: %s", iface)
 	}
 	raw := f.Imports[0].Path.Value   // "io"
 	path, err = strconv.Unquote(raw) // io
@@ -91,15 +214,43 @@ func findInterface(iface string, srcDir string) (path string, id string, err err
 	}
 	decl := f.Decls[1].(*ast.GenDecl)      // var i io.Reader
 	spec := decl.Specs[0].(*ast.ValueSpec) // i io.Reader
-	sel := spec.Type.(*ast.SelectorExpr)   // io.Reader
-	id = sel.Sel.Name                      // Reader
-	return path, id, nil
+	sel, targs, err := splitSelector(spec.Type)
+	if err != nil {
+		return "", Type{}, err
+	}
+	args := make([]string, len(targs))
+	for i, a := range targs {
+		args[i] = exprString(a)
+	}
+	return path, Type{Name: sel.Sel.Name, Args: args}, nil
 }
 
-// Pkg is a parsed build.Package.
+// Pkg is a type-checked package, loaded via golang.org/x/tools/go/packages
+// so that fullType can rely on real type information instead of guessing
+// from identifier casing.
 type Pkg struct {
-	*build.Package
-	*token.FileSet
+	*packages.Package
+	// ImportAliases maps an import path to the alias the interface's
+	// source file gave it, if any, so generated references match what
+	// the user already wrote.
+	ImportAliases map[string]string
+	// SelfPackage is the import path the generated mock will itself live
+	// in (set via --self_package), or "" if the mock lives in its own,
+	// separate package. Types from SelfPackage are rendered unqualified
+	// instead of package-prefixed.
+	SelfPackage string
+	// Registry is the same registry instance generate uses to emit the
+	// mock's import block, so a package qualifier renders while
+	// qualifying a type (e.g. "rand.Foo") always matches the alias that
+	// package's import line actually declares.
+	Registry *registry
+	// Subst is the type-parameter substitution, if any, already applied
+	// to the method declaration fullType is rendering (see
+	// typeParamSubst/substIdents). fullType uses it to tell a
+	// substituted composite type (e.g. "[]V" rewritten to "[]int") apart
+	// from an untouched one, since go/types' recorded type for the
+	// former's unchanged outer node is the stale, pre-substitution type.
+	Subst map[string]ast.Expr
 }
 
 // Spec is ast.TypeSpec with the associated comment map.
@@ -108,24 +259,36 @@ type Spec struct {
 	ast.CommentMap
 }
 
+// packagesLoadMode is the set of information typeSpec needs from
+// packages.Load: type-checked declarations (NeedTypes/NeedTypesInfo),
+// syntax trees for doc comments (NeedSyntax), and enough import
+// information to resolve embedded interfaces in other packages
+// (NeedImports/NeedDeps).
+const packagesLoadMode = packages.NeedName | packages.NeedTypes | packages.NeedTypesInfo |
+	packages.NeedSyntax | packages.NeedImports | packages.NeedDeps
+
 // typeSpec locates the *ast.TypeSpec for type id in the import path.
-func typeSpec(path string, id string, srcDir string) (Pkg, Spec, []*ast.ImportSpec, error) {
-	pkg, err := build.Import(path, srcDir, 0)
+// id is the bare type name; any type arguments are handled by the caller.
+// selfPackage is the import path the generated mock will live in (see
+// Pkg.SelfPackage), or "" if it lives in its own, separate package. reg is
+// shared across every interface in the run (see Pkg.Registry), so import
+// aliases stay consistent across them.
+func typeSpec(path string, id string, srcDir string, selfPackage string, reg *registry) (Pkg, Spec, []*ast.ImportSpec, error) {
+	cfg := &packages.Config{Mode: packagesLoadMode, Dir: srcDir}
+	pkgs, err := packages.Load(cfg, path)
 	if err != nil {
 		return Pkg{}, Spec{}, nil, fmt.Errorf("couldn't find package %s: %v", path, err)
 	}
+	if len(pkgs) == 0 {
+		return Pkg{}, Spec{}, nil, fmt.Errorf("couldn't find package %s", path)
+	}
+	pkg := pkgs[0]
+	if len(pkg.Errors) > 0 {
+		return Pkg{}, Spec{}, nil, fmt.Errorf("couldn't load package %s: %v", path, pkg.Errors[0])
+	}
 
-	fset := token.NewFileSet() // share one fset across the whole package
-	var files []string
-	files = append(files, pkg.GoFiles...)
-	files = append(files, pkg.CgoFiles...)
-	for _, file := range files {
-		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, file), nil, parser.ParseComments)
-		if err != nil {
-			continue
-		}
-
-		cmap := ast.NewCommentMap(fset, f, f.Comments)
+	for _, f := range pkg.Syntax {
+		cmap := ast.NewCommentMap(pkg.Fset, f, f.Comments)
 
 		for _, decl := range f.Decls {
 			decl, ok := decl.(*ast.GenDecl)
@@ -137,7 +300,7 @@ func typeSpec(path string, id string, srcDir string) (Pkg, Spec, []*ast.ImportSp
 				if spec.Name.Name != id {
 					continue
 				}
-				p := Pkg{Package: pkg, FileSet: fset}
+				p := Pkg{Package: pkg, ImportAliases: importAliases(f.Imports), SelfPackage: selfPackage, Registry: reg}
 				s := Spec{TypeSpec: spec, CommentMap: cmap.Filter(decl)}
 				return p, s, f.Imports, nil
 			}
@@ -146,10 +309,55 @@ func typeSpec(path string, id string, srcDir string) (Pkg, Spec, []*ast.ImportSp
 	return Pkg{}, Spec{}, nil, fmt.Errorf("type %s not found in %s", id, path)
 }
 
+// importAliases builds an import-path -> alias map from a file's
+// import declarations, recording only the imports that named an alias.
+func importAliases(imports []*ast.ImportSpec) map[string]string {
+	aliases := make(map[string]string)
+	for _, imp := range imports {
+		if imp.Name == nil || imp.Path == nil {
+			continue
+		}
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		aliases[path] = imp.Name.Name
+	}
+	return aliases
+}
+
+// dir returns the directory containing p's source files, for resolving
+// embedded interfaces relative to the package that actually declares
+// them rather than the caller's original source directory.
+func (p Pkg) dir() string {
+	if len(p.GoFiles) > 0 {
+		return filepath.Dir(p.GoFiles[0])
+	}
+	return ""
+}
+
+// qualifier returns a types.Qualifier that renders every referenced
+// package, including p's own, using whatever import alias the
+// interface's source file chose for it, falling back to an alias
+// p.Registry assigns. The generated mock always lives in a different
+// package than the interface it mocks, so p's own types still need
+// qualifying. Going through p.Registry, the same instance generate later
+// emits the import block from, guarantees a package referenced by two
+// colliding import paths (e.g. crypto/rand and math/rand) is qualified
+// here with the exact alias its import line declares there.
+func (p Pkg) qualifier() types.Qualifier {
+	return func(other *types.Package) string {
+		if other.Path() == p.SelfPackage {
+			return ""
+		}
+		return p.Registry.resolve(other.Path(), other.Name(), p.ImportAliases[other.Path()])
+	}
+}
+
 // gofmt pretty-prints e.
 func (p Pkg) gofmt(e ast.Expr) string {
 	var buf bytes.Buffer
-	printer.Fprint(&buf, p.FileSet, e)
+	printer.Fprint(&buf, p.Fset, e)
 	return buf.String()
 }
 
@@ -160,15 +368,24 @@ func (p Pkg) gofmt(e ast.Expr) string {
 // 	fullType(io.Reader) => "io.Reader"
 // 	fullType(*Request) => "*http.Request"
 func (p Pkg) fullType(e ast.Expr) string {
+	// A composite type (e.g. *ast.ArrayType, *ast.MapType) that embeds a
+	// substituted type parameter keeps its own node identity - only its
+	// child was replaced - so go/types' recorded type for it, looked up
+	// by that identity, is still the pre-substitution generic type
+	// (e.g. "[]V"). Rendering that instead of "[]int" would silently
+	// undo the substitution, so such a type always takes the AST
+	// fallback below rather than the TypesInfo fast path.
+	if t := p.TypesInfo.TypeOf(e); t != nil && !containsSubstitution(e, p.Subst) {
+		return types.TypeString(t, p.qualifier())
+	}
+	// e has no type information, typically because it was synthesized by
+	// generic type-argument substitution rather than parsed from p's own
+	// source; fall back to qualifying exported identifiers by name.
 	ast.Inspect(e, func(n ast.Node) bool {
 		switch n := n.(type) {
 		case *ast.Ident:
-			// Using typeSpec instead of IsExported here would be
-			// more accurate, but it'd be crazy expensive, and if
-			// the type isn't exported, there's no point trying
-			// to implement it anyway.
 			if n.IsExported() {
-				n.Name = p.Package.Name + "." + n.Name
+				n.Name = p.Name + "." + n.Name
 			}
 		case *ast.SelectorExpr:
 			return false
@@ -178,24 +395,133 @@ func (p Pkg) fullType(e ast.Expr) string {
 	return p.gofmt(e)
 }
 
-func (p Pkg) params(field *ast.Field) []Param {
+// params renders field's names and type into Params, deriving a readable
+// name for anonymous or blank-identifier parameters and disambiguating it
+// against used, which tracks every parameter name already assigned in the
+// enclosing signature.
+func (p Pkg) params(field *ast.Field, used map[string]bool) []Param {
 	var params []Param
 	typ := p.fullType(field.Type)
+	variadic := false
+	if ellipsis, ok := field.Type.(*ast.Ellipsis); ok {
+		// go/types resolves an Ellipsis field to its slice type (e.g.
+		// "[]interface{}"), dropping the "..." that fullType's rendering
+		// relies on elsewhere, so restore it here directly from the AST.
+		typ = "..." + p.fullType(ellipsis.Elt)
+		variadic = true
+	}
 	for _, name := range field.Names {
-		params = append(params, Param{Name: name.Name, Type: typ})
+		n := name.Name
+		if n == "" || n == "_" {
+			n = paramName(typ, used)
+		} else {
+			used[n] = true
+		}
+		params = append(params, Param{Name: n, Type: typ, Variadic: variadic})
 	}
 	// Handle anonymous params
+	if len(params) == 0 {
+		params = []Param{Param{Name: paramName(typ, used), Type: typ, Variadic: variadic}}
+	}
+	return params
+}
+
+// resParams renders field as Params for a result list. Unlike params, it
+// leaves anonymous results unnamed: Go result lists are as commonly
+// unnamed as named, so there is no ad-hoc identifier to disambiguate.
+func (p Pkg) resParams(field *ast.Field) []Param {
+	typ := p.fullType(field.Type)
+	var params []Param
+	for _, name := range field.Names {
+		params = append(params, Param{Name: name.Name, Type: typ})
+	}
 	if len(params) == 0 {
 		params = []Param{Param{Type: typ}}
 	}
 	return params
 }
 
+// callLog renders the call-log field-struct type and append literal for a
+// method's parameter list, naming fields positionally (P0, P1, ...). A
+// variadic parameter's "..." is rendered as its slice type ("[]T"), since
+// within the method body the parameter is itself a slice.
+func callLog(params []Param) (typ, lit string) {
+	var t, l strings.Builder
+	t.WriteString("struct{ ")
+	l.WriteString("{")
+	for i, p := range params {
+		ft := p.Type
+		if p.Variadic {
+			ft = "[]" + strings.TrimPrefix(ft, "...")
+		}
+		fmt.Fprintf(&t, "P%d %s; ", i, ft)
+		fmt.Fprintf(&l, "P%d: %s, ", i, p.Name)
+	}
+	t.WriteString("}")
+	l.WriteString("}")
+	typ = t.String()
+	return typ, typ + l.String()
+}
+
+// returnsType renders the field-struct type for a method's FooReturns
+// fallback value, naming fields positionally (R0, R1, ...). It is empty
+// for methods with no results, since there is nothing to fall back to.
+func returnsType(res []Param) string {
+	if len(res) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("struct{ ")
+	for i, r := range res {
+		fmt.Fprintf(&b, "R%d %s; ", i, r.Type)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// returnsExprs renders the comma-joined field accesses into recvVar's
+// nameReturns used to satisfy res when name's FooMock is nil. Empty if res
+// is empty.
+func returnsExprs(recvVar, name string, res []Param) string {
+	if len(res) == 0 {
+		return ""
+	}
+	exprs := make([]string, len(res))
+	for i := range res {
+		exprs[i] = fmt.Sprintf("%s.%sReturns.R%d", recvVar, name, i)
+	}
+	return strings.Join(exprs, ", ")
+}
+
 // Method represents a method signature.
 type Method struct {
 	Recv     string
 	RecvVar  string
 	RecvName string
+	// TypeParams is the bracketed type parameter declaration list to
+	// render after RecvName in the struct's type declaration, e.g.
+	// "[K comparable, V any]". It is empty unless the mock is for the
+	// uninstantiated form of a generic interface.
+	TypeParams string
+	// RecvTypeParams is the bracketed type parameter name list, e.g.
+	// "[K, V]", for use on method receivers, which may not repeat
+	// constraints.
+	RecvTypeParams string
+	// CallLogType is the rendered field-struct type recording one call to
+	// the method, e.g. "struct{ P0 string; P1 int }". Fields are named
+	// positionally (P0, P1, ...) since params aren't always named or
+	// distinct.
+	CallLogType string
+	// CallLogLit is the struct literal appended to FooCalls by each
+	// invocation, e.g. "struct{ P0 string; P1 int }{P0: s, P1: i}".
+	CallLogLit string
+	// ReturnsType is CallLogType's counterpart for results, e.g.
+	// "struct{ R0 error }". Empty if the method has no results.
+	ReturnsType string
+	// ReturnsExprs is the comma-joined field accesses into FooReturns used
+	// to satisfy the method's result list when FooMock is nil. Empty if
+	// the method has no results.
+	ReturnsExprs string
 	Func
 }
 
@@ -214,27 +540,112 @@ type Param struct {
 	Variadic bool
 }
 
+// paramName derives a unique, readable name for an anonymous parameter of
+// the given type and reserves it in used, which tracks every name already
+// assigned in the enclosing signature.
+func paramName(typ string, used map[string]bool) string {
+	name := deriveParamName(typ)
+	candidate := name
+	for n := 2; used[candidate]; n++ {
+		candidate = name + strconv.Itoa(n)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// deriveParamName guesses a short, readable identifier from a type's
+// rendered name: "string" -> "s", "[]Foo" -> "foos",
+// "map[string]int" -> "stringToInt", "chan Event" -> "eventCh".
+func deriveParamName(typ string) string {
+	switch {
+	case strings.HasPrefix(typ, "..."):
+		return deriveParamName(typ[3:])
+	case strings.HasPrefix(typ, "[]"):
+		return lowerFirst(baseName(typ[2:])) + "s"
+	case strings.HasPrefix(typ, "map["):
+		if i := strings.Index(typ, "]"); i > 0 {
+			key, val := typ[len("map["):i], typ[i+1:]
+			return lowerFirst(baseName(key)) + "To" + upperFirst(baseName(val))
+		}
+	case strings.HasPrefix(typ, "chan "):
+		return lowerFirst(baseName(strings.TrimPrefix(typ, "chan "))) + "Ch"
+	case strings.HasPrefix(typ, "<-chan "):
+		return lowerFirst(baseName(strings.TrimPrefix(typ, "<-chan "))) + "Ch"
+	case strings.HasPrefix(typ, "chan<- "):
+		return lowerFirst(baseName(strings.TrimPrefix(typ, "chan<- "))) + "Ch"
+	}
+	switch typ {
+	case "error":
+		return "err"
+	case "bool":
+		return "b"
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr":
+		return "i"
+	case "float32", "float64":
+		return "f"
+	case "byte", "rune":
+		return lowerFirst(typ)
+	case "string":
+		return "s"
+	}
+	return lowerFirst(baseName(typ))
+}
+
+// baseName strips pointer, selector, and array/slice decoration from a
+// rendered type name to the identifier a variable name can be derived
+// from, e.g. "*http.Request" -> "Request", "[2]Foo" -> "Foo".
+func baseName(typ string) string {
+	typ = strings.TrimPrefix(typ, "*")
+	if i := strings.LastIndex(typ, "]"); i >= 0 {
+		typ = typ[i+1:]
+	}
+	if i := strings.LastIndex(typ, "."); i >= 0 {
+		typ = typ[i+1:]
+	}
+	for _, r := range typ {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			// typ isn't a plain identifier, e.g. "struct{}" or
+			// "func(int) error"; there's no good name to derive from it.
+			return "v"
+		}
+	}
+	if typ == "" || unicode.IsDigit(rune(typ[0])) {
+		return "v"
+	}
+	return typ
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
 func (p Pkg) funcsig(f *ast.Field, cmap ast.CommentMap) Func {
 	fn := Func{Name: f.Names[0].Name}
 	typ := f.Type.(*ast.FuncType)
 	if typ.Params != nil {
-		for i, field := range typ.Params.List {
-			for _, param := range p.params(field) {
-				// only for method parameters:
-				// assign a blank identifier "_" to an anonymous parameter
-				if param.Name == "" || param.Name == "_" {
-					param.Name = "p" + strconv.Itoa(i)
-				}
-				if param.Type[0:3] == "..." {
-					param.Variadic = true
-				}
-				fn.Params = append(fn.Params, param)
-			}
+		used := map[string]bool{}
+		for _, field := range typ.Params.List {
+			fn.Params = append(fn.Params, p.params(field, used)...)
 		}
 	}
 	if typ.Results != nil {
 		for _, field := range typ.Results.List {
-			fn.Res = append(fn.Res, p.params(field)...)
+			fn.Res = append(fn.Res, p.resParams(field)...)
 		}
 	}
 	if commentsBefore(f, cmap.Comments()) {
@@ -249,132 +660,526 @@ var errorInterface = []Func{{
 	Res:  []Param{{Type: "string"}},
 }}
 
-// funcs returns the set of methods required to implement iface.
+// typeParamInfo describes the bracketed type parameter list to emit on a
+// mock generated for the uninstantiated form of a generic interface.
+// Decls (e.g. "K comparable") belongs on the type declaration; Names
+// (e.g. "K") belongs on method receivers, which may not repeat
+// constraints.
+type typeParamInfo struct {
+	Decls []string
+	Names []string
+}
+
+// typeParamSubst builds an identifier substitution map for a generic
+// interface's type parameters given the type arguments the user supplied
+// in typ. When typ carries no arguments, the interface's own type
+// parameters are returned as tp so the caller can keep the
+// uninstantiated form, e.g. render the mock as MockStore[K comparable, V any].
+func (p Pkg) typeParamSubst(ts *ast.TypeSpec, typ Type) (subst map[string]ast.Expr, tp typeParamInfo, err error) {
+	if ts.TypeParams == nil {
+		if len(typ.Args) > 0 {
+			return nil, typeParamInfo{}, fmt.Errorf("%s is not a generic interface", typ.Name)
+		}
+		return nil, typeParamInfo{}, nil
+	}
+
+	var names, decls []string
+	for _, field := range ts.TypeParams.List {
+		constraint := p.fullType(field.Type)
+		for _, n := range field.Names {
+			names = append(names, n.Name)
+			decls = append(decls, n.Name+" "+constraint)
+		}
+	}
+
+	if len(typ.Args) == 0 {
+		// Uninstantiated form: leave the method signatures alone and
+		// let the caller declare the mock as generic.
+		return nil, typeParamInfo{Decls: decls, Names: names}, nil
+	}
+	if len(typ.Args) != len(names) {
+		return nil, typeParamInfo{}, fmt.Errorf("wrong number of type arguments for %s: got %d, want %d", typ.Name, len(typ.Args), len(names))
+	}
+
+	subst = make(map[string]ast.Expr, len(names))
+	for i, name := range names {
+		arg, err := parser.ParseExpr(typ.Args[i])
+		if err != nil {
+			return nil, typeParamInfo{}, fmt.Errorf("couldn't parse type argument %q: %s", typ.Args[i], err)
+		}
+		// arg's positions come from parser.ParseExpr's own throwaway
+		// file set, not p.Fset. Once substIdents splices it into a node
+		// from p's real source and fullType prints that node through
+		// p.Fset, the mismatched positions read as huge line gaps to
+		// go/printer, which "preserves" them as blank lines in the
+		// output. Clearing them makes the printer fall back to its
+		// default, position-independent spacing.
+		clearExprPos(arg)
+		subst[name] = arg
+	}
+	return subst, typeParamInfo{}, nil
+}
+
+// clearExprPos recursively zeroes every token.Pos field of e, so that
+// printing e through a *token.FileSet it was never recorded in (see
+// typeParamSubst) doesn't mistake its leftover positions for huge gaps
+// in the source and "preserve" them as blank lines.
+func clearExprPos(e ast.Expr) {
+	switch e := e.(type) {
+	case *ast.Ident:
+		e.NamePos = token.NoPos
+	case *ast.StarExpr:
+		e.Star = token.NoPos
+		clearExprPos(e.X)
+	case *ast.Ellipsis:
+		e.Ellipsis = token.NoPos
+		if e.Elt != nil {
+			clearExprPos(e.Elt)
+		}
+	case *ast.ParenExpr:
+		e.Lparen, e.Rparen = token.NoPos, token.NoPos
+		clearExprPos(e.X)
+	case *ast.SelectorExpr:
+		clearExprPos(e.X)
+		clearExprPos(e.Sel)
+	case *ast.IndexExpr:
+		clearExprPos(e.X)
+		clearExprPos(e.Index)
+	case *ast.ArrayType:
+		e.Lbrack = token.NoPos
+		if e.Len != nil {
+			clearExprPos(e.Len)
+		}
+		clearExprPos(e.Elt)
+	case *ast.MapType:
+		e.Map = token.NoPos
+		clearExprPos(e.Key)
+		clearExprPos(e.Value)
+	case *ast.ChanType:
+		e.Begin, e.Arrow = token.NoPos, token.NoPos
+		clearExprPos(e.Value)
+	case *ast.StructType:
+		e.Struct = token.NoPos
+		if e.Fields != nil {
+			e.Fields.Opening, e.Fields.Closing = token.NoPos, token.NoPos
+			for _, f := range e.Fields.List {
+				clearExprPos(f.Type)
+			}
+		}
+	case *ast.InterfaceType:
+		e.Interface = token.NoPos
+		if e.Methods != nil {
+			e.Methods.Opening, e.Methods.Closing = token.NoPos, token.NoPos
+		}
+	case *ast.FuncType:
+		e.Func = token.NoPos
+		clearFieldListPos(e.Params)
+		clearFieldListPos(e.Results)
+	}
+}
+
+// clearFieldListPos is clearExprPos's helper for the parameter/result
+// field lists of a *ast.FuncType.
+func clearFieldListPos(fl *ast.FieldList) {
+	if fl == nil {
+		return
+	}
+	fl.Opening, fl.Closing = token.NoPos, token.NoPos
+	for _, f := range fl.List {
+		clearExprPos(f.Type)
+	}
+}
+
+// substIdents rewrites every *ast.Ident in n naming a key of subst with
+// its associated replacement expression.
+func substIdents(n ast.Node, subst map[string]ast.Expr) ast.Node {
+	return astutil.Apply(n, func(c *astutil.Cursor) bool {
+		if id, ok := c.Node().(*ast.Ident); ok {
+			if repl, ok := subst[id.Name]; ok {
+				c.Replace(repl)
+			}
+		}
+		return true
+	}, nil)
+}
+
+// containsSubstitution reports whether e is, or contains, one of the
+// replacement expressions substIdents spliced in for subst - i.e.
+// whether e was touched by type-parameter substitution anywhere in its
+// subtree. fullType uses this to tell a composite type that embeds a
+// substituted type parameter (whose own node identity, and so its
+// go/types-recorded type, predates the substitution) apart from one
+// that doesn't.
+func containsSubstitution(e ast.Expr, subst map[string]ast.Expr) bool {
+	if len(subst) == 0 {
+		return false
+	}
+	replacement := make(map[ast.Expr]bool, len(subst))
+	for _, repl := range subst {
+		replacement[repl] = true
+	}
+	found := false
+	ast.Inspect(e, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		if expr, ok := n.(ast.Expr); ok && replacement[expr] {
+			found = true
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// funcs returns the set of methods required to implement iface, along
+// with the type parameters left unsubstituted (because the caller asked
+// for the interface's uninstantiated generic form). reg is shared across
+// every interface in the run (see Pkg.Registry), so import aliases stay
+// consistent across them.
 // It is called funcs rather than methods because the
 // function descriptions are functions; there is no receiver.
-func funcs(iface string, srcDir string) ([]Func, []*ast.ImportSpec, error) {
+func funcs(iface string, srcDir string, selfPackage string, reg *registry) ([]Func, []*ast.ImportSpec, typeParamInfo, error) {
 	// Special case for the built-in error interface.
 	if iface == "error" {
-		return errorInterface, nil, nil
+		return errorInterface, nil, typeParamInfo{}, nil
 	}
 
 	// Locate the interface.
-	path, id, err := findInterface(iface, srcDir)
+	path, typ, err := findInterface(iface, srcDir)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, typeParamInfo{}, err
 	}
 
 	// Parse the package and find the interface declaration.
-	p, spec, astImpt, err := typeSpec(path, id, srcDir)
+	p, spec, astImpt, err := typeSpec(path, typ.Name, srcDir, selfPackage, reg)
 	if err != nil {
-		return nil, nil, fmt.Errorf("interface %s not found: %s", iface, err)
+		return nil, nil, typeParamInfo{}, fmt.Errorf("interface %s not found: %s", iface, err)
 	}
 	idecl, ok := spec.Type.(*ast.InterfaceType)
 	if !ok {
-		return nil, nil, fmt.Errorf("not an interface: %s", iface)
+		return nil, nil, typeParamInfo{}, fmt.Errorf("not an interface: %s", iface)
 	}
 
 	if idecl.Methods == nil {
-		return nil, nil, fmt.Errorf("empty interface: %s", iface)
+		return nil, nil, typeParamInfo{}, fmt.Errorf("empty interface: %s", iface)
 	}
 
+	subst, tp, err := p.typeParamSubst(spec.TypeSpec, typ)
+	if err != nil {
+		return nil, nil, typeParamInfo{}, fmt.Errorf("interface %s: %s", iface, err)
+	}
+	p.Subst = subst
+
 	var fns []Func
 	for _, fndecl := range idecl.Methods.List {
 		if len(fndecl.Names) == 0 {
-			// Embedded interface: recurse
-			var embedded []Func
-			embedded, astImpt, err = funcs(p.fullType(fndecl.Type), srcDir)
+			// Embedded interface: recurse, resolving relative to the
+			// package that actually declares it (which may live outside
+			// srcDir's module, e.g. io.Reader embedded in a third-party
+			// package) rather than the original caller's srcDir. Append
+			// its imports rather than replacing ours, so a Store
+			// embedding both Getter and Putter keeps both of their
+			// import lines instead of only the last one's.
+			embedded, embeddedImpt, _, err := funcs(p.fullType(fndecl.Type), p.dir(), selfPackage, reg)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, typeParamInfo{}, err
 			}
 			fns = append(fns, embedded...)
+			astImpt = append(astImpt, embeddedImpt...)
 			continue
 		}
 
-		fn := p.funcsig(fndecl, spec.CommentMap.Filter(fndecl))
+		methodDecl := fndecl
+		if len(subst) > 0 {
+			methodDecl = substIdents(fndecl, subst).(*ast.Field)
+		}
+
+		fn := p.funcsig(methodDecl, spec.CommentMap.Filter(fndecl))
 		fns = append(fns, fn)
 	}
-	return fns, astImpt, nil
+	return fns, astImpt, tp, nil
 }
 
 const stub = "// {{.Name}} Mock\n" +
 	"{{if .Comments}}{{.Comments}}{{end}}" +
-	"func ({{.Recv}}) {{.Name}}" +
+	"func ({{.Recv}}{{.RecvTypeParams}}) {{.Name}}" +
 	"({{range .Params}}{{.Name}} {{.Type}}, {{end}})" +
 	"({{range .Res}}{{.Name}} {{.Type}}, {{end}})" +
 	"{\n" +
-	`if {{.RecvVar}}.{{.Name}}Mock == nil { ` +
+	"{{.RecvVar}}.mu.Lock()\n" +
+	"{{.RecvVar}}.{{.Name}}Calls = append({{.RecvVar}}.{{.Name}}Calls, {{.CallLogLit}})\n" +
+	"{{.RecvVar}}.mu.Unlock()\n" +
+	`if {{.RecvVar}}.{{.Name}}Mock == nil {` + "\n" +
+	"{{if .Res}}" +
+	"return {{.ReturnsExprs}}\n" +
+	"{{else}}" +
 	`{{.RecvVar}}.T.Log("\n" + string(debug.Stack()) + "\n")` + "\n" +
-	`{{.RecvVar}}.T.Fatal("Unimplemented mock {{.Recv}}.{{.Name}} was called") }` + "\n" +
+	`{{.RecvVar}}.T.Fatal("Unimplemented mock {{.Recv}}.{{.Name}} was called")` + "\n" +
+	"{{end}}" +
+	"}\n" +
 	`{{if .Res}}return{{end}} {{.RecvVar}}.{{.Name}}Mock` +
 	`({{range .Params}}{{.Name}}{{if .Variadic }}...{{end}},  {{end}})` +
 	"\n}\n\n"
 
 const mockStruct = "// {{.RecvName}} Mock\n" +
-	"type {{.RecvName}} struct {\n" +
-	"T *testing.T \n"
+	"type {{.RecvName}}{{.TypeParams}} struct {\n" +
+	"T *testing.T \n" +
+	"mu sync.Mutex \n"
 
 const methodDeclaration = "{{.Name}}Mock func" +
 	"({{range .Params}}{{.Name}} {{.Type}}, {{end}})" +
-	"({{range .Res}}{{.Name}} {{.Type}}, {{end}})\n"
+	"({{range .Res}}{{.Name}} {{.Type}}, {{end}})\n" +
+	"{{.Name}}Calls []{{.CallLogType}}\n" +
+	"{{if .ReturnsType}}{{.Name}}Returns {{.ReturnsType}}\n{{end}}"
+
+const callHelpers = "// {{.Name}}CallCount returns the number of times {{.Name}} was called.\n" +
+	"func ({{.Recv}}{{.RecvTypeParams}}) {{.Name}}CallCount() int {\n" +
+	"{{.RecvVar}}.mu.Lock()\n" +
+	"defer {{.RecvVar}}.mu.Unlock()\n" +
+	"return len({{.RecvVar}}.{{.Name}}Calls)\n" +
+	"}\n\n" +
+	"// {{.Name}}CalledWith returns the arguments passed to the i'th call of {{.Name}}.\n" +
+	"func ({{.Recv}}{{.RecvTypeParams}}) {{.Name}}CalledWith(i int) {{.CallLogType}} {\n" +
+	"{{.RecvVar}}.mu.Lock()\n" +
+	"defer {{.RecvVar}}.mu.Unlock()\n" +
+	"return {{.RecvVar}}.{{.Name}}Calls[i]\n" +
+	"}\n\n"
 
 var tmpl = template.Must(template.New("test").Parse(stub))
 var tmplMockStruct = template.Must(template.New("test").Parse(mockStruct))
 var tmplMethodDeclaration = template.Must(template.New("test").Parse(methodDeclaration))
+var tmplCallHelpers = template.Must(template.New("test").Parse(callHelpers))
 
-// genStubs prints nicely formatted method stubs
-// for fns using receiver expression recv.
-// If recv is not a valid receiver expression,
-// genStubs will panic.
-// genStubs won't generate stubs for
-// alrzeady implemented methods of receiver.
-func genStubs(packageName, recv string, fns []Func, srcDir string, astImpt []*ast.ImportSpec, ifacePath string) []byte {
-	var buf bytes.Buffer
+// registry deduplicates import paths and allocates distinct aliases when
+// two imports share a base name (e.g. crypto/rand and math/rand both
+// resolve to "rand"), so genStubs and genStubsRecorder don't have to
+// reason about import collisions themselves. A single registry instance
+// is shared between Pkg.qualifier, which decides how a package is
+// referred to in the generated body, and generate's import block, which
+// must declare that exact same alias; resolve is the shared source of
+// truth both go through.
+type registry struct {
+	alias    map[string]string // import path -> alias already assigned to it
+	explicit map[string]bool   // import path -> alias must be printed even without a collision
+	used     map[string]bool   // alias names already claimed
+	printed  map[string]bool   // import paths already emitted in the import block
+}
 
-	buf.Write([]byte("package " + packageName + "\n"))
+func newRegistry() *registry {
+	return &registry{
+		alias:    map[string]string{},
+		explicit: map[string]bool{},
+		used:     map[string]bool{},
+		printed:  map[string]bool{},
+	}
+}
 
-	buf.Write([]byte("import (\n"))
-	buf.Write([]byte(`"` + ifacePath + `"` + "\n"))
-	if astImpt != nil {
-		for _, i := range astImpt {
-			if i.Path == nil {
-				continue
-			}
-			if i.Name != nil {
-				buf.Write([]byte(i.Name.Name + " "))
-			}
-			buf.Write([]byte(i.Path.Value + "\n"))
-		}
+// skip marks path as already registered under no alias, so neither
+// resolve nor importLine ever emit an import for it. Used to elide the
+// self-import when --self_package names ifacePath.
+func (r *registry) skip(path string) {
+	r.alias[path] = ""
+	r.printed[path] = true
+}
+
+// resolve returns the alias path should be referred to by everywhere in
+// the generated file, registering it under sourceAlias (the alias the
+// source already declared, or "" if the source left the import
+// unaliased) the first time path is seen. pkgName is the package's own
+// declared name - the identifier an unaliased import of path actually
+// binds - used as the fallback base instead of guessing from path's
+// last segment, since the two can differ (e.g. import path
+// ".../pkgrand2" declaring "package rand"). Later calls for the same
+// path return the same alias regardless of what's passed, so a package
+// two different interfaces both reference - one via an explicit source
+// alias, one without - is still qualified consistently throughout the
+// file. The base is given a numbered alias if it collides with a
+// previously registered import.
+func (r *registry) resolve(path, pkgName, sourceAlias string) string {
+	if alias, ok := r.alias[path]; ok {
+		return alias
 	}
-	buf.Write([]byte(")\n"))
+	base := sourceAlias
+	if base == "" {
+		base = pkgName
+	}
+	alias := base
+	for n := 2; r.used[alias]; n++ {
+		alias = base + strconv.Itoa(n)
+	}
+	r.used[alias] = true
+	r.alias[path] = alias
+	r.explicit[path] = sourceAlias != "" || alias != pkgName
+	return alias
+}
 
+// importLine returns the source text for an import of path under
+// sourceAlias ("" if the source left it unaliased), or "" if path was
+// already printed by a prior call. The alias is resolved through the
+// same bookkeeping as qualifier's calls to resolve, so the import block
+// always matches what the generated body actually refers to; if
+// qualifier already resolved path (the common case, since every type
+// actually referenced in a rendered signature goes through it first),
+// this just returns that cached alias. Otherwise - an import present in
+// source but never referenced in the mocked signatures - there's no
+// type-checked package name to fall back on, so pkgName is guessed from
+// path's last segment; any mismatch is harmless since goimports strips
+// the (also unreferenced) import from the final output.
+func (r *registry) importLine(path, sourceAlias string) string {
+	if r.printed[path] {
+		return ""
+	}
+	r.printed[path] = true
+	pkgName := sourceAlias
+	if pkgName == "" {
+		pkgName = path[strings.LastIndex(path, "/")+1:]
+	}
+	alias := r.resolve(path, pkgName, sourceAlias)
+	if alias == "" {
+		return ""
+	}
+	if !r.explicit[path] {
+		return strconv.Quote(path)
+	}
+	return alias + " " + strconv.Quote(path)
+}
+
+// disambiguateRecv returns recvVar, or a decollided variant if one of
+// params is named recvVar, so the generated receiver and parameter list
+// don't declare the same identifier twice in one signature.
+func disambiguateRecv(recvVar string, params []Param) string {
+	used := map[string]bool{}
+	for _, p := range params {
+		used[p.Name] = true
+	}
+	if !used[recvVar] {
+		return recvVar
+	}
+	candidate := recvVar
+	for n := 2; used[candidate]; n++ {
+		candidate = recvVar + strconv.Itoa(n)
+	}
+	return candidate
+}
+
+// ifaceEntry holds what generate needs to emit one interface's mock: its
+// methods, the imports its source file used (for embedded interfaces
+// resolved elsewhere), and its generic type parameters, if any.
+type ifaceEntry struct {
+	RecvName   string
+	Fns        []Func
+	AstImpt    []*ast.ImportSpec
+	TypeParams typeParamInfo
+}
+
+// writeFuncBody appends the default "mock function field" style struct
+// and methods for one interface to buf.
+// writeFuncBody won't generate stubs for already implemented methods of
+// the receiver.
+func writeFuncBody(buf *bytes.Buffer, recvName string, fns []Func, tp typeParamInfo) {
+	typeParamsStr, recvTypeParamsStr := "", ""
+	if len(tp.Decls) > 0 {
+		typeParamsStr = "[" + strings.Join(tp.Decls, ", ") + "]"
+		recvTypeParamsStr = "[" + strings.Join(tp.Names, ", ") + "]"
+	}
+	recvType := "*" + recvName
+
+	meths := make([]Method, len(fns))
 	for i, fn := range fns {
-		recvVar := strings.Split(recv, " ")[0]
-		recvName := strings.Split(recv, " ")[1][1:]
-		meth := Method{Recv: recv, Func: fn, RecvName: recvName, RecvVar: recvVar}
+		recvVar := disambiguateRecv("m", fn.Params)
+		callLogType, callLogLit := callLog(fn.Params)
+		meths[i] = Method{
+			Recv: recvVar + " " + recvType, Func: fn, RecvName: recvName, RecvVar: recvVar,
+			TypeParams: typeParamsStr, RecvTypeParams: recvTypeParamsStr,
+			CallLogType: callLogType, CallLogLit: callLogLit,
+			ReturnsType: returnsType(fn.Res), ReturnsExprs: returnsExprs(recvVar, fn.Name, fn.Res),
+		}
+	}
 
+	for i, meth := range meths {
 		if i == 0 {
-			tmplMockStruct.Execute(&buf, meth)
+			tmplMockStruct.Execute(buf, meth)
 		}
 
-		tmplMethodDeclaration.Execute(&buf, meth)
+		tmplMethodDeclaration.Execute(buf, meth)
 
-		if i == len(fns)-1 {
+		if i == len(meths)-1 {
 			buf.Write([]byte("}\n"))
 		}
-
 	}
 
-	for _, fn := range fns {
-		recvVar := strings.Split(recv, " ")[0]
-		recvName := strings.Split(recv, " ")[1][1:]
-		meth := Method{Recv: recv, Func: fn, RecvName: recvName, RecvVar: recvVar}
+	for _, meth := range meths {
+		if err := tmpl.Execute(buf, meth); err != nil {
+			panic(err)
+		}
+	}
 
-		err := tmpl.Execute(&buf, meth)
-		if err != nil {
+	for _, meth := range meths {
+		if err := tmplCallHelpers.Execute(buf, meth); err != nil {
 			panic(err)
 		}
 	}
+}
+
+// generate renders the mock(s) for entries into a single Go source file:
+// one package header and import block covering every entry (deduplicated
+// and alias-disambiguated via reg, eliding selfPackage if set), followed
+// by each entry's struct and methods in the requested style. reg is the
+// same instance funcs used to resolve each entry's qualified types, so
+// the import block matches what the bodies actually refer to.
+func generate(packageName, style, srcDir, ifacePath, selfPackage string, entries []ifaceEntry, reg *registry) []byte {
+	var buf bytes.Buffer
+
+	buf.Write([]byte("package " + packageName + "\n"))
+
+	buf.Write([]byte("import (\n"))
+	if line := reg.importLine(ifacePath, ""); line != "" {
+		buf.Write([]byte(line + "\n"))
+	}
+	if style == "recorder" {
+		for _, path := range []string{"reflect", "go.uber.org/mock/gomock"} {
+			if line := reg.importLine(path, ""); line != "" {
+				buf.Write([]byte(line + "\n"))
+			}
+		}
+	}
+	for _, e := range entries {
+		for _, i := range e.AstImpt {
+			if i.Path == nil {
+				continue
+			}
+			path, err := strconv.Unquote(i.Path.Value)
+			if err != nil {
+				continue
+			}
+			name := ""
+			if i.Name != nil {
+				name = i.Name.Name
+			}
+			if line := reg.importLine(path, name); line != "" {
+				buf.Write([]byte(line + "\n"))
+			}
+		}
+	}
+	buf.Write([]byte(")\n"))
+
+	for _, e := range entries {
+		if style == "recorder" {
+			writeRecorderBody(&buf, "Mock"+e.RecvName, e.RecvName, e.Fns, e.TypeParams)
+		} else {
+			recvName := e.RecvName
+			if selfPackage != "" {
+				// --self_package puts the mock in the same package as the
+				// interface it mocks; prefix it like the recorder style
+				// always does so it doesn't collide with the interface's
+				// own declaration (e.g. "type Store struct" vs "type
+				// Store interface" in the same package).
+				recvName = "Mock" + recvName
+			}
+			writeFuncBody(&buf, recvName, e.Fns, e.TypeParams)
+		}
+	}
 
 	pretty, err := imports.Process(srcDir+"/mock.go", buf.Bytes(), nil)
 	if err != nil {
@@ -383,6 +1188,126 @@ func genStubs(packageName, recv string, fns []Func, srcDir string, astImpt []*as
 	return pretty
 }
 
+// recorderHeader is the struct pair, constructor, and EXPECT() accessor
+// emitted once per interface in --style=recorder output.
+type recorderHeader struct {
+	RecvName  string // e.g. "MockFoo"
+	IfaceName string // e.g. "Foo"
+	// TypeParams and RecvTypeParams mirror Method's fields of the same
+	// name: TypeParams (e.g. "[K comparable, V any]") belongs on a type
+	// declaration, RecvTypeParams (e.g. "[K, V]") on a use of that type
+	// elsewhere (receivers, composite literals, reflect.TypeOf).
+	TypeParams     string
+	RecvTypeParams string
+}
+
+// RecorderMethod is the template view for a single method rendered in
+// --style=recorder output: the call-forwarding method on the mock plus
+// its EXPECT() shim on the paired recorder.
+type RecorderMethod struct {
+	RecvName       string // e.g. "MockFoo"
+	RecvTypeParams string // e.g. "[K, V]"
+	Func
+	// FixedParams are Func.Params with the trailing variadic parameter,
+	// if any, removed; VariadicParam holds that trailing parameter.
+	FixedParams   []Param
+	VariadicParam Param
+}
+
+func newRecorderMethod(recvName, recvTypeParams string, fn Func) RecorderMethod {
+	rm := RecorderMethod{RecvName: recvName, RecvTypeParams: recvTypeParams, Func: fn, FixedParams: fn.Params}
+	if n := len(fn.Params); n > 0 && fn.Params[n-1].Variadic {
+		rm.FixedParams = fn.Params[:n-1]
+		rm.VariadicParam = fn.Params[n-1]
+	}
+	return rm
+}
+
+const recorderHeaderTmpl = "// {{.RecvName}} is a mock of the {{.IfaceName}} interface.\n" +
+	"type {{.RecvName}}{{.TypeParams}} struct {\n" +
+	"\tctrl     *gomock.Controller\n" +
+	"\trecorder *{{.RecvName}}MockRecorder{{.RecvTypeParams}}\n" +
+	"}\n\n" +
+	"// {{.RecvName}}MockRecorder is the mock recorder for {{.RecvName}}.\n" +
+	"type {{.RecvName}}MockRecorder{{.TypeParams}} struct {\n" +
+	"\tmock *{{.RecvName}}{{.RecvTypeParams}}\n" +
+	"}\n\n" +
+	"// New{{.RecvName}} creates a new mock instance.\n" +
+	"func New{{.RecvName}}{{.TypeParams}}(ctrl *gomock.Controller) *{{.RecvName}}{{.RecvTypeParams}} {\n" +
+	"\tmock := &{{.RecvName}}{{.RecvTypeParams}}{ctrl: ctrl}\n" +
+	"\tmock.recorder = &{{.RecvName}}MockRecorder{{.RecvTypeParams}}{mock}\n" +
+	"\treturn mock\n" +
+	"}\n\n" +
+	"// EXPECT returns an object that allows the caller to indicate expected use.\n" +
+	"func (m *{{.RecvName}}{{.RecvTypeParams}}) EXPECT() *{{.RecvName}}MockRecorder{{.RecvTypeParams}} {\n" +
+	"\treturn m.recorder\n" +
+	"}\n\n"
+
+const recorderCallMethodTmpl = "{{if .Comments}}{{.Comments}}{{end}}" +
+	"// {{.Name}} mocks base method.\n" +
+	"func (m *{{.RecvName}}{{.RecvTypeParams}}) {{.Name}}" +
+	"({{range .Params}}{{.Name}} {{.Type}}, {{end}})" +
+	"({{range .Res}}{{.Type}}, {{end}}) {\n" +
+	"\tm.ctrl.T.Helper()\n" +
+	"{{if .VariadicParam.Name}}" +
+	"\tvarargs := []interface" + "{{\"{\"}}{{\"}\"}}" + "{{\"{\"}}{{range .FixedParams}}{{.Name}}, {{end}}{{\"}\"}}\n" +
+	"\tfor _, a := range {{.VariadicParam.Name}} {\n" +
+	"\t\tvarargs = append(varargs, a)\n" +
+	"\t}\n" +
+	"\t{{if .Res}}ret := {{end}}m.ctrl.Call(m, \"{{.Name}}\", varargs...)\n" +
+	"{{else}}" +
+	"\t{{if .Res}}ret := {{end}}m.ctrl.Call(m, \"{{.Name}}\"{{range .Params}}, {{.Name}}{{end}})\n" +
+	"{{end}}" +
+	"{{range $i, $r := .Res}}\tret{{$i}}, _ := ret[{{$i}}].({{$r.Type}})\n{{end}}" +
+	"{{if .Res}}\treturn {{range $i, $r := .Res}}{{if $i}}, {{end}}ret{{$i}}{{end}}\n{{end}}" +
+	"}\n\n"
+
+const recorderShimMethodTmpl = "// {{.Name}} indicates an expected call of {{.Name}}.\n" +
+	"func (mr *{{.RecvName}}MockRecorder{{.RecvTypeParams}}) {{.Name}}" +
+	"({{range .Params}}{{.Name}} {{if .Variadic}}...{{end}}interface" + "{{\"{\"}}{{\"}\"}}" + ", {{end}})" +
+	" *gomock.Call {\n" +
+	"\tmr.mock.ctrl.T.Helper()\n" +
+	"{{if .VariadicParam.Name}}" +
+	"\tvarargs := append([]interface" + "{{\"{\"}}{{\"}\"}}" + "{{\"{\"}}{{range .FixedParams}}{{.Name}}, {{end}}{{\"}\"}}, {{.VariadicParam.Name}}...)\n" +
+	"\treturn mr.mock.ctrl.RecordCallWithMethodType(mr.mock, \"{{.Name}}\", reflect.TypeOf((*{{.RecvName}}{{.RecvTypeParams}})(nil).{{.Name}}), varargs...)\n" +
+	"{{else}}" +
+	"\treturn mr.mock.ctrl.RecordCallWithMethodType(mr.mock, \"{{.Name}}\", reflect.TypeOf((*{{.RecvName}}{{.RecvTypeParams}})(nil).{{.Name}}){{range .Params}}, {{.Name}}{{end}})\n" +
+	"{{end}}" +
+	"}\n\n"
+
+var tmplRecorderHeader = template.Must(template.New("recorderHeader").Parse(recorderHeaderTmpl))
+var tmplRecorderCallMethod = template.Must(template.New("recorderCallMethod").Parse(recorderCallMethodTmpl))
+var tmplRecorderShimMethod = template.Must(template.New("recorderShimMethod").Parse(recorderShimMethodTmpl))
+
+// writeRecorderBody appends a gomock-style EXPECT() recorder mock for fns
+// to buf: a mockName struct embedding a *gomock.Controller, a paired
+// mockNameMockRecorder, and per-method call-forwarding/recorder pairs.
+// This is a drop-in replacement for mockgen/golang-mock output, for
+// callers who want EXPECT().Foo(...).Return(...) ergonomics instead of
+// the default function-field style.
+func writeRecorderBody(buf *bytes.Buffer, mockName, ifaceName string, fns []Func, tp typeParamInfo) {
+	typeParamsStr, recvTypeParamsStr := "", ""
+	if len(tp.Decls) > 0 {
+		typeParamsStr = "[" + strings.Join(tp.Decls, ", ") + "]"
+		recvTypeParamsStr = "[" + strings.Join(tp.Names, ", ") + "]"
+	}
+
+	tmplRecorderHeader.Execute(buf, recorderHeader{
+		RecvName: mockName, IfaceName: ifaceName,
+		TypeParams: typeParamsStr, RecvTypeParams: recvTypeParamsStr,
+	})
+
+	for _, fn := range fns {
+		rm := newRecorderMethod(mockName, recvTypeParamsStr, fn)
+		if err := tmplRecorderCallMethod.Execute(buf, rm); err != nil {
+			panic(err)
+		}
+		if err := tmplRecorderShimMethod.Execute(buf, rm); err != nil {
+			panic(err)
+		}
+	}
+}
+
 // commentsBefore reports whether commentGroups precedes a field.
 func commentsBefore(field *ast.Field, cg []*ast.CommentGroup) bool {
 	if len(cg) > 0 {
@@ -429,6 +1354,9 @@ func main() {
 	getopt.SetParameters(usageParameters)
 	optDir := getopt.StringLong("directory", 'd', pwd, "package source directory, useful for vendored code")
 	optPKGName := getopt.StringLong("package", 'p', "mocks", "package name")
+	optStyle := getopt.StringLong("style", 0, "func", "output style: func (mock function fields, default) or recorder (gomock-style EXPECT())")
+	optDestination := getopt.StringLong("destination", 0, "", "output file to write the mock(s) to, instead of stdout; parent directories are created as needed")
+	optSelfPackage := getopt.StringLong("self_package", 0, "", "import path the generated mock will itself live in; elides the self-import and the interface's own package qualifier")
 	optHelp := getopt.BoolLong("help", 'h', "Help")
 	getopt.Parse()
 
@@ -437,19 +1365,48 @@ func main() {
 		getopt.Usage()
 		os.Exit(0)
 	}
+	if *optStyle != "func" && *optStyle != "recorder" {
+		fatal(fmt.Sprintf("unknown --style %q: want \"func\" or \"recorder\"", *optStyle))
+	}
 
 	ifacePath := getopt.Arg(0)
-	ifaceName := getopt.Arg(1)
-	recv := "m *" + ifaceName
 
-	iface := ifacePath + "." + ifaceName
-	fns, astImpt, err := funcs(iface, *optDir)
-	if err != nil {
-		fatal(err)
+	reg := newRegistry()
+	if *optSelfPackage != "" {
+		reg.skip(*optSelfPackage)
+	}
+
+	var entries []ifaceEntry
+	for _, ifaceName := range splitInterfaceNames(getopt.Arg(1)) {
+		recvName := ifaceName
+		if bracket := strings.Index(ifaceName, "["); bracket > -1 {
+			// Strip any user-supplied type arguments, e.g. "Store[string,int]",
+			// since an instantiated mock's receiver names the bare type.
+			recvName = ifaceName[:bracket]
+		}
+
+		iface := ifacePath + "." + ifaceName
+		fns, astImpt, tp, err := funcs(iface, *optDir, *optSelfPackage, reg)
+		if err != nil {
+			fatal(err)
+		}
+		entries = append(entries, ifaceEntry{RecvName: recvName, Fns: fns, AstImpt: astImpt, TypeParams: tp})
 	}
 
-	src := genStubs(*optPKGName, recv, fns, *optDir, astImpt, ifacePath)
-	fmt.Print(string(src))
+	src := generate(*optPKGName, *optStyle, *optDir, ifacePath, *optSelfPackage, entries, reg)
+
+	if *optDestination == "" {
+		fmt.Print(string(src))
+		return
+	}
+	if dir := filepath.Dir(*optDestination); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			fatal(err)
+		}
+	}
+	if err := os.WriteFile(*optDestination, src, 0o644); err != nil {
+		fatal(err)
+	}
 }
 
 func fatal(msg interface{}) {
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"go/types"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseTypeName(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    Type
+		wantErr bool
+	}{
+		{name: "bare", in: "ResponseWriter", want: Type{Name: "ResponseWriter"}},
+		{name: "single arg", in: "Store[string]", want: Type{Name: "Store", Args: []string{"string"}}},
+		{name: "multiple args", in: "Store[string, int]", want: Type{Name: "Store", Args: []string{"string", "int"}}},
+		{name: "invalid syntax", in: "Store[", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTypeName(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTypeName(%q): want error, got %+v", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTypeName(%q): unexpected error: %v", tt.in, err)
+			}
+			if got.Name != tt.want.Name || !equalStrings(got.Args, tt.want.Args) {
+				t.Fatalf("parseTypeName(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSplitInterfaceNames(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "Reader", want: []string{"Reader"}},
+		{in: "Reader,Writer,Closer", want: []string{"Reader", "Writer", "Closer"}},
+		{in: "Store[string, int]", want: []string{"Store[string, int]"}},
+		{in: "Store[string, int],Other", want: []string{"Store[string, int]", "Other"}},
+		{in: "Store[string,int],Reader,Writer", want: []string{"Store[string,int]", "Reader", "Writer"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := splitInterfaceNames(tt.in); !equalStrings(got, tt.want) {
+				t.Fatalf("splitInterfaceNames(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindInterfaceFullyQualified(t *testing.T) {
+	path, typ, err := findInterface("net/http.ResponseWriter", t.TempDir())
+	if err != nil {
+		t.Fatalf("findInterface: unexpected error: %v", err)
+	}
+	if path != "net/http" || typ.Name != "ResponseWriter" {
+		t.Fatalf("findInterface = (%q, %+v), want (\"net/http\", ResponseWriter)", path, typ)
+	}
+}
+
+func TestFindInterfaceRejectsTrailingSlash(t *testing.T) {
+	if _, _, err := findInterface("net/http/", t.TempDir()); err == nil {
+		t.Fatal("findInterface(\"net/http/\"): want error, got nil")
+	}
+}
+
+func TestRegistryDedupesImportPaths(t *testing.T) {
+	reg := newRegistry()
+	first := reg.importLine("io", "")
+	second := reg.importLine("io", "")
+	if first != `"io"` {
+		t.Fatalf("first importLine(io) = %q, want %q", first, `"io"`)
+	}
+	if second != "" {
+		t.Fatalf("second importLine(io) = %q, want empty (already registered)", second)
+	}
+}
+
+func TestRegistryAliasesCollidingBaseNames(t *testing.T) {
+	reg := newRegistry()
+	cryptoLine := reg.importLine("crypto/rand", "")
+	mathLine := reg.importLine("math/rand", "")
+
+	if cryptoLine != `"crypto/rand"` {
+		t.Fatalf("crypto/rand import line = %q, want bare %q", cryptoLine, `"crypto/rand"`)
+	}
+	if !strings.HasPrefix(mathLine, "rand2 ") {
+		t.Fatalf("math/rand import line = %q, want a renamed alias", mathLine)
+	}
+}
+
+func TestRegistrySkipElidesImport(t *testing.T) {
+	reg := newRegistry()
+	reg.skip("mypkg")
+	if line := reg.importLine("mypkg", ""); line != "" {
+		t.Fatalf("importLine after skip = %q, want empty", line)
+	}
+}
+
+// TestQualifierMatchesImportBlock reproduces the crypto/rand vs math/rand
+// scenario from chunk0-4: two packages whose import paths collide on the
+// same base name must be qualified, in the generated body, with the exact
+// alias their shared registry also emits in the import block.
+func TestQualifierMatchesImportBlock(t *testing.T) {
+	reg := newRegistry()
+	p1 := Pkg{Registry: reg}
+	p2 := Pkg{Registry: reg}
+
+	cryptoRand := types.NewPackage("crypto/rand", "rand")
+	mathRand := types.NewPackage("math/rand", "rand")
+
+	cryptoAlias := p1.qualifier()(cryptoRand)
+	mathAlias := p2.qualifier()(mathRand)
+	if cryptoAlias == mathAlias {
+		t.Fatalf("qualifier gave colliding packages the same alias: %q", cryptoAlias)
+	}
+
+	cryptoLine := reg.importLine(cryptoRand.Path(), "")
+	mathLine := reg.importLine(mathRand.Path(), "")
+	if !strings.Contains(cryptoLine, cryptoAlias) && cryptoAlias != "rand" {
+		t.Fatalf("crypto/rand import line %q doesn't match qualifier alias %q", cryptoLine, cryptoAlias)
+	}
+	if !strings.Contains(mathLine, mathAlias) {
+		t.Fatalf("math/rand import line %q doesn't match qualifier alias %q", mathLine, mathAlias)
+	}
+}
+
+// TestQualifierUsesDeclaredPackageName guards against deriving an alias
+// from an import path's last segment instead of the package's actual
+// declared name: an import path like ".../pkgrand" whose package clause
+// is "package rand" must be qualified, and imported, as "rand" - not
+// "pkgrand" - or the generated body and import line bind two different
+// identifiers.
+func TestQualifierUsesDeclaredPackageName(t *testing.T) {
+	reg := newRegistry()
+	p := Pkg{Registry: reg}
+
+	pkg := types.NewPackage("example.com/pkgrand", "rand")
+	alias := p.qualifier()(pkg)
+	if alias != "rand" {
+		t.Fatalf("qualifier(%s) = %q, want the declared name %q", pkg.Path(), alias, "rand")
+	}
+
+	line := reg.importLine(pkg.Path(), "")
+	if line != strconv.Quote(pkg.Path()) {
+		t.Fatalf("importLine = %q, want a bare import of %q since the alias matches the declared name", line, pkg.Path())
+	}
+}
+
+// TestFuncsMergesEmbeddedInterfaceImports builds a tiny on-disk module
+// where Store embeds Getter and Putter, declared in separate files that
+// each unaliased-import a distinct package both named "rand" - the
+// chunk0-4 regression: the generated mock must retain both embedded
+// interfaces' imports, aliased apart, and refer to each using the exact
+// alias its import line declares.
+func TestFuncsMergesEmbeddedInterfaceImports(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel, content string) {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/m\n\ngo 1.21\n")
+	write("randa/a.go", "package rand\n\ntype Custom struct{}\n")
+	write("randb/b.go", "package rand\n\ntype Other struct{}\n")
+	write("mypkg/getter.go", `package mypkg
+
+import "example.com/m/randa"
+
+type Getter interface {
+	Get() rand.Custom
+}
+`)
+	write("mypkg/putter.go", `package mypkg
+
+import "example.com/m/randb"
+
+type Putter interface {
+	Put() rand.Other
+}
+`)
+	write("mypkg/store.go", `package mypkg
+
+type Store interface {
+	Getter
+	Putter
+}
+`)
+
+	// findInterface's bare-name resolution for an embedded interface
+	// shells out to goimports, which guesses an import path by scanning
+	// packages from the current process's working directory - it won't
+	// see a synthetic module unless the process actually runs from
+	// inside it. Build the real binary and exec it there, the same way
+	// a user invoking gomock against this module would.
+	bin := filepath.Join(t.TempDir(), "gomock")
+	build := exec.Command("go", "build", "-o", bin, ".")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("go build gomock: %v\n%s", err, out)
+	}
+
+	cmd := exec.Command(bin, "-d", filepath.Join(dir, "mypkg"), "example.com/m/mypkg", "Store")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("gomock: %v\n%s", err, out)
+	}
+
+	if !strings.Contains(string(out), `rand "example.com/m/randa"`) {
+		t.Fatalf("expected randa imported as rand, got:\n%s", out)
+	}
+	if !strings.Contains(string(out), `rand2 "example.com/m/randb"`) {
+		t.Fatalf("expected randb imported under the renumbered alias rand2, got:\n%s", out)
+	}
+	if !strings.Contains(string(out), "rand.Custom") || !strings.Contains(string(out), "rand2.Other") {
+		t.Fatalf("expected the body to reference rand.Custom and rand2.Other, got:\n%s", out)
+	}
+}
+
+// TestGenericCompositeTypeSubstitutionCompiles is the chunk0-1 regression:
+// a generic interface whose methods embed a type parameter inside a
+// composite type (slice, map, pointer, func param) rather than using it
+// as a method's bare top-level type. substIdents only rewrites the
+// identifier node, leaving the enclosing composite AST node's identity -
+// and so its go/types-recorded, pre-substitution type - unchanged;
+// fullType's fast path used to trust that stale type and emit "V"/"K"
+// with no declaration in scope.
+func TestGenericCompositeTypeSubstitutionCompiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel, content string) {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/m\n\ngo 1.21\n")
+	write("mypkg/cache.go", `package mypkg
+
+type Cache[K comparable, V any] interface {
+	GetAll() ([]V, error)
+	GetMap() map[K]V
+	GetPtr() *V
+	Each(func(K, V) bool)
+}
+`)
+
+	bin := filepath.Join(t.TempDir(), "gomock")
+	build := exec.Command("go", "build", "-o", bin, ".")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("go build gomock: %v\n%s", err, out)
+	}
+
+	cmd := exec.Command(bin, "-d", filepath.Join(dir, "mypkg"), "example.com/m/mypkg", "Cache[string,int]")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("gomock: %v\n%s", err, out)
+	}
+	if strings.Contains(string(out), "undefined") || strings.Contains(string(out), "]V") || strings.Contains(string(out), "]K") {
+		t.Fatalf("generated mock still references the unsubstituted type parameter:\n%s", out)
+	}
+	if strings.Contains(string(out), "\n\n)") {
+		t.Fatalf("substituted type argument left stale positions that printed as blank lines:\n%s", out)
+	}
+
+	mockDir := filepath.Join(dir, "mockmypkg")
+	if err := os.MkdirAll(mockDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mockDir, "cache_mock.go"), out, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	build = exec.Command("go", "build", "./...")
+	build.Dir = dir
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("generated mock does not compile: %v\n%s", err, out)
+	}
+}
+
+// TestGenerateRecorderStyleThreadsTypeParams is the chunk0-3 regression:
+// --style=recorder dropped a generic interface's type parameters
+// entirely, emitting a non-generic MockFoo struct whose methods still
+// referenced K/V with no declaration anywhere.
+func TestGenerateRecorderStyleThreadsTypeParams(t *testing.T) {
+	entries := []ifaceEntry{{
+		RecvName: "Cache",
+		Fns: []Func{{
+			Name: "Get",
+			Res:  []Param{{Type: "V"}},
+		}},
+		TypeParams: typeParamInfo{
+			Decls: []string{"K comparable", "V any"},
+			Names: []string{"K", "V"},
+		},
+	}}
+
+	reg := newRegistry()
+	out := string(generate("mypkg", "recorder", t.TempDir(), "mocks", "mypkg", entries, reg))
+
+	if !strings.Contains(out, "type MockCache[K comparable, V any] struct") {
+		t.Fatalf("expected MockCache to declare its type parameters, got:\n%s", out)
+	}
+	if !strings.Contains(out, "func (m *MockCache[K, V]) Get() V") {
+		t.Fatalf("expected Get to be rendered on the instantiated receiver, got:\n%s", out)
+	}
+	if !strings.Contains(out, "func (mr *MockCacheMockRecorder[K, V]) Get()") {
+		t.Fatalf("expected the recorder shim to be rendered on the instantiated receiver, got:\n%s", out)
+	}
+}
+
+func TestGenerateSelfPackageAvoidsNameCollision(t *testing.T) {
+	entries := []ifaceEntry{{
+		RecvName: "Store",
+		Fns: []Func{{
+			Name:   "Get",
+			Params: []Param{{Name: "key", Type: "string"}},
+			Res:    []Param{{Type: "error"}},
+		}},
+	}}
+
+	reg := newRegistry()
+	reg.skip("mypkg")
+	out := string(generate("mypkg", "func", t.TempDir(), "mypkg", "mypkg", entries, reg))
+
+	if strings.Contains(out, "type Store struct") {
+		t.Fatalf("mock struct collides with the Store interface it mocks:\n%s", out)
+	}
+	if !strings.Contains(out, "type MockStore struct") {
+		t.Fatalf("expected a MockStore struct when --self_package is set, got:\n%s", out)
+	}
+}